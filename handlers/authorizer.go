@@ -0,0 +1,22 @@
+package handlers
+
+import "github.com/vouch/vouch-proxy/pkg/structs"
+
+// Authorizer is an additional authorization check run from VerifyUser,
+// alongside the WhiteList/TeamWhiteList/Domains switch, so a provider can
+// enforce requirements that switch can't express on its own - a verified
+// email, or membership in an external group directory. An Authorizer may
+// also populate fields on user (e.g. TeamMemberships) that the switch then
+// evaluates. A failing Authorizer returns a specific error string that
+// CallbackHandler renders for the user via renderIndex.
+type Authorizer interface {
+	Authorize(user *structs.User, ptokens structs.PTokens) (bool, error)
+}
+
+var authorizers []Authorizer
+
+// registerAuthorizer adds a to the chain VerifyUser runs; providers call
+// this from handlers.Configure() when their relevant cfg option is enabled
+func registerAuthorizer(a Authorizer) {
+	authorizers = append(authorizers, a)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/vouch/vouch-proxy/pkg/structs"
+)
+
+var githubEmailsURL = "https://api.github.com/user/emails"
+
+// githubVerifiedEmailAuthorizer rejects logins whose GitHub primary email
+// is not marked verified. It is registered when cfg.Cfg.RequireVerifiedEmail
+// is set and the configured provider is GitHub.
+type githubVerifiedEmailAuthorizer struct{}
+
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+func (githubVerifiedEmailAuthorizer) Authorize(user *structs.User, ptokens structs.PTokens) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, githubEmailsURL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "token "+ptokens.PAccessToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("github: unable to fetch /user/emails: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return false, fmt.Errorf("github: /user/emails returned %s: %s", resp.Status, body)
+	}
+
+	var emails []githubEmail
+	if err := json.NewDecoder(resp.Body).Decode(&emails); err != nil {
+		return false, fmt.Errorf("github: unable to decode /user/emails response: %w", err)
+	}
+
+	for _, e := range emails {
+		if e.Primary {
+			if !e.Verified {
+				return false, fmt.Errorf("github primary email %s is not verified", e.Email)
+			}
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("github account %s has no primary email", user.Username)
+}
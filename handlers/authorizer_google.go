@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"os"
+
+	"github.com/vouch/vouch-proxy/pkg/cfg"
+	"github.com/vouch/vouch-proxy/pkg/structs"
+	"golang.org/x/oauth2/google"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/option"
+)
+
+// googleGroupAuthorizer populates user.TeamMemberships with every Google
+// Group in cfg.Cfg.TeamWhiteList that user.Email belongs to, checked via the
+// Admin SDK Directory API using a domain-wide-delegated service account, so
+// TeamWhiteList entries like "group@example.com" work for the Google
+// provider the same way "myclient:admin" does for Keycloak. It never
+// rejects the login itself; it only supplies membership data for the
+// TeamWhiteList switch in VerifyUser to evaluate.
+type googleGroupAuthorizer struct{}
+
+func (googleGroupAuthorizer) Authorize(user *structs.User, ptokens structs.PTokens) (bool, error) {
+	if len(cfg.Cfg.TeamWhiteList) == 0 {
+		return true, nil
+	}
+
+	svc, err := newDirectoryService()
+	if err != nil {
+		// fail open, per the doc comment above: a transient Admin API/service
+		// account problem shouldn't take down every login while TeamWhiteList
+		// is set, only the group-membership data it would have supplied
+		log.Errorf("google groups: unable to build admin directory client, skipping group lookup: %s", err)
+		return true, nil
+	}
+
+	for _, group := range cfg.Cfg.TeamWhiteList {
+		member, err := svc.Members.HasMember(group, user.Email).Do()
+		if err != nil {
+			log.Debugf("google groups: HasMember(%s, %s) error: %s", group, user.Email, err)
+			continue
+		}
+		if member.IsMember {
+			user.TeamMemberships = append(user.TeamMemberships, group)
+		}
+	}
+	return true, nil
+}
+
+func newDirectoryService() (*admin.Service, error) {
+	b, err := os.ReadFile(cfg.Cfg.GoogleServiceAccountJSON)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := google.JWTConfigFromJSON(b, admin.AdminDirectoryGroupReadonlyScope)
+	if err != nil {
+		return nil, err
+	}
+	conf.Subject = cfg.Cfg.GoogleAdminEmail
+
+	ctx := context.Background()
+	return admin.NewService(ctx, option.WithHTTPClient(conf.Client(ctx)))
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vouch/vouch-proxy/pkg/cfg"
+	"github.com/vouch/vouch-proxy/pkg/structs"
+	"go.uber.org/zap"
+)
+
+func TestGithubVerifiedEmailAuthorizerAcceptsVerifiedPrimary(t *testing.T) {
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"email":"alice@example.com","primary":true,"verified":true}]`))
+	}))
+	defer mock.Close()
+	origURL := githubEmailsURL
+	t.Cleanup(func() { githubEmailsURL = origURL })
+	githubEmailsURL = mock.URL
+
+	user := structs.User{Username: "alice"}
+	ok, err := (githubVerifiedEmailAuthorizer{}).Authorize(&user, structs.PTokens{PAccessToken: "tok"})
+	if err != nil || !ok {
+		t.Fatalf("expected a verified primary email to authorize, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestGithubVerifiedEmailAuthorizerRejectsUnverifiedPrimary(t *testing.T) {
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"email":"alice@example.com","primary":true,"verified":false}]`))
+	}))
+	defer mock.Close()
+	origURL := githubEmailsURL
+	t.Cleanup(func() { githubEmailsURL = origURL })
+	githubEmailsURL = mock.URL
+
+	user := structs.User{Username: "alice"}
+	ok, err := (githubVerifiedEmailAuthorizer{}).Authorize(&user, structs.PTokens{PAccessToken: "tok"})
+	if ok || err == nil {
+		t.Fatalf("expected an unverified primary email to be rejected, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestGithubVerifiedEmailAuthorizerRejectsNon200Response(t *testing.T) {
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"message":"Bad credentials"}`))
+	}))
+	defer mock.Close()
+	origURL := githubEmailsURL
+	t.Cleanup(func() { githubEmailsURL = origURL })
+	githubEmailsURL = mock.URL
+
+	user := structs.User{Username: "alice"}
+	ok, err := (githubVerifiedEmailAuthorizer{}).Authorize(&user, structs.PTokens{PAccessToken: "tok"})
+	if ok || err == nil {
+		t.Fatal("expected a non-200 /user/emails response to be rejected explicitly, not coincidentally")
+	}
+}
+
+func TestGoogleGroupAuthorizerFailsOpenOnDirectoryServiceError(t *testing.T) {
+	log = zap.NewNop().Sugar()
+	cfg.Cfg.TeamWhiteList = []string{"group@example.com"}
+	cfg.Cfg.GoogleServiceAccountJSON = "/nonexistent/service-account.json"
+	t.Cleanup(func() {
+		cfg.Cfg.TeamWhiteList = nil
+		cfg.Cfg.GoogleServiceAccountJSON = ""
+	})
+
+	user := structs.User{Username: "alice", Email: "alice@example.com"}
+	ok, err := (googleGroupAuthorizer{}).Authorize(&user, structs.PTokens{})
+	if !ok {
+		t.Fatalf("expected googleGroupAuthorizer to fail open when the directory service can't be built, got ok=%v err=%v", ok, err)
+	}
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/vouch/vouch-proxy/pkg/cfg"
+	"github.com/vouch/vouch-proxy/pkg/jwtmanager"
+	"github.com/vouch/vouch-proxy/pkg/structs"
+)
+
+// jwksRefreshInterval controls how often a trusted issuer's JWKS is re-fetched
+const jwksRefreshInterval = 10 * time.Minute
+
+// jwk is the subset of RFC 7517 fields vouch needs to build an *rsa.PublicKey
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+type oidcDiscovery struct {
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// issuerKeySet caches the verification keys for a single trusted external issuer
+type issuerKeySet struct {
+	mu          sync.RWMutex
+	issuer      cfg.ExtraJwtIssuer
+	keysByKid   map[string]*rsa.PublicKey
+	lastFetched time.Time
+}
+
+var (
+	extIssuersMu sync.RWMutex
+	extIssuers   map[string]*issuerKeySet
+)
+
+// configureExtraJwtIssuers builds the cache of trusted external issuers from
+// cfg.Cfg.ExtraJwtIssuers and performs the initial JWKS fetch for each one
+func configureExtraJwtIssuers() {
+	extIssuersMu.Lock()
+	defer extIssuersMu.Unlock()
+
+	extIssuers = make(map[string]*issuerKeySet, len(cfg.Cfg.ExtraJwtIssuers))
+	for _, iss := range cfg.Cfg.ExtraJwtIssuers {
+		ks := &issuerKeySet{issuer: iss}
+		if err := ks.refresh(); err != nil {
+			log.Errorf("ExtraJwtIssuers: unable to fetch jwks for issuer %s: %s", iss.Issuer, err)
+		}
+		extIssuers[iss.Issuer] = ks
+	}
+}
+
+// claimsFromExternalJWT verifies jwtStr against whichever configured
+// ExtraJwtIssuers entry matches the token's `iss` claim, and maps the
+// configured username claim into claims.Username
+func claimsFromExternalJWT(jwtStr string) (jwtmanager.VouchClaims, error) {
+	var claims jwtmanager.VouchClaims
+
+	unverified := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(jwtStr, unverified); err != nil {
+		return claims, err
+	}
+	iss, _ := unverified["iss"].(string)
+	if iss == "" {
+		return claims, fmt.Errorf("external jwt has no iss claim")
+	}
+
+	extIssuersMu.RLock()
+	ks, ok := extIssuers[iss]
+	extIssuersMu.RUnlock()
+	if !ok {
+		return claims, fmt.Errorf("no ExtraJwtIssuers entry configured for iss %s", iss)
+	}
+
+	key, err := ks.keyFor(jwtStr)
+	if err != nil {
+		return claims, err
+	}
+
+	token, err := jwt.Parse(jwtStr, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return key, nil
+	})
+	if err != nil || !token.Valid {
+		return claims, fmt.Errorf("external jwt failed validation: %w", err)
+	}
+
+	mapClaims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return claims, fmt.Errorf("external jwt: could not read claims")
+	}
+	if !mapClaims.VerifyAudience(ks.issuer.Audience, true) || !mapClaims.VerifyIssuer(ks.issuer.Issuer, true) {
+		return claims, fmt.Errorf("external jwt aud/iss does not match ExtraJwtIssuers entry %s", iss)
+	}
+
+	usernameClaim := ks.issuer.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "email"
+	}
+	username, _ := mapClaims[usernameClaim].(string)
+	if username == "" {
+		return claims, fmt.Errorf("external jwt missing configured username claim %s", usernameClaim)
+	}
+
+	claims.Username = username
+	claims.CustomClaims = structs.CustomClaims(mapClaims)
+	// mark this as externally-issued so ValidateRequestHandler knows not to
+	// run jwtmanager.SiteInClaims against it - see isExternallyIssued
+	claims.CustomClaims[externalIssuerMarkerClaim] = iss
+	log.Debugf("validated external jwt for issuer %s, username %s", iss, username)
+	return claims, nil
+}
+
+// externalIssuerMarkerClaim is stashed in claims.CustomClaims by
+// claimsFromExternalJWT so ValidateRequestHandler can recognize a token
+// that came from a trusted external issuer rather than from Vouch itself
+const externalIssuerMarkerClaim = "vouchExternalIssuer"
+
+// isExternallyIssued reports whether claims were validated via an
+// ExtraJwtIssuers entry rather than minted by Vouch's own CallbackHandler
+func isExternallyIssued(claims jwtmanager.VouchClaims) bool {
+	_, ok := claims.CustomClaims[externalIssuerMarkerClaim]
+	return ok
+}
+
+// keyFor returns the rsa.PublicKey matching jwtStr's `kid` header, refreshing
+// the cached jwks if the kid isn't known yet or the cache has gone stale
+func (ks *issuerKeySet) keyFor(jwtStr string) (*rsa.PublicKey, error) {
+	token, _, err := new(jwt.Parser).ParseUnverified(jwtStr, jwt.MapClaims{})
+	if err != nil {
+		return nil, err
+	}
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("external jwt has no kid header")
+	}
+
+	ks.mu.RLock()
+	key, ok := ks.keysByKid[kid]
+	stale := time.Since(ks.lastFetched) > jwksRefreshInterval
+	ks.mu.RUnlock()
+	if ok && !stale {
+		return key, nil
+	}
+
+	if err := ks.refresh(); err != nil {
+		return nil, err
+	}
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, ok = ks.keysByKid[kid]
+	if !ok {
+		return nil, fmt.Errorf("no key found for kid %s issued by %s", kid, ks.issuer.Issuer)
+	}
+	return key, nil
+}
+
+// refresh fetches (or re-fetches) the issuer's JWKS, resolving the jwks_uri
+// via OpenID discovery first if an explicit jwks_uri wasn't configured
+func (ks *issuerKeySet) refresh() error {
+	jwksURI := ks.issuer.JWKSURI
+	if jwksURI == "" {
+		d, err := fetchDiscovery(ks.issuer.DiscoveryURL)
+		if err != nil {
+			return err
+		}
+		jwksURI = d.JWKSURI
+	}
+
+	set, err := fetchJWKSet(jwksURI)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		pub, err := rsaPublicKeyFromJWK(k)
+		if err != nil {
+			log.Errorf("ExtraJwtIssuers: skipping malformed jwk kid %s for issuer %s: %s", k.Kid, ks.issuer.Issuer, err)
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	ks.mu.Lock()
+	ks.keysByKid = keys
+	ks.lastFetched = time.Now()
+	ks.mu.Unlock()
+	return nil
+}
+
+func fetchDiscovery(url string) (oidcDiscovery, error) {
+	var d oidcDiscovery
+	resp, err := http.Get(url)
+	if err != nil {
+		return d, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return d, err
+	}
+	if d.JWKSURI == "" {
+		return d, fmt.Errorf("discovery document at %s did not contain jwks_uri", url)
+	}
+	return d, nil
+}
+
+func fetchJWKSet(url string) (jwkSet, error) {
+	var set jwkSet
+	resp, err := http.Get(url)
+	if err != nil {
+		return set, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return set, err
+	}
+	return set, nil
+}
+
+func rsaPublicKeyFromJWK(k jwk) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nBytes),
+		E: int(new(big.Int).SetBytes(eBytes).Int64()),
+	}, nil
+}
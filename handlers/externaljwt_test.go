@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/vouch/vouch-proxy/pkg/cfg"
+	"go.uber.org/zap"
+)
+
+func TestClaimsFromExternalJWT(t *testing.T) {
+	log = zap.NewNop().Sugar()
+
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := "test-kid"
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := base64.RawURLEncoding.EncodeToString(priv.PublicKey.N.Bytes())
+		e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(priv.PublicKey.E)).Bytes())
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"keys":[{"kty":"RSA","kid":"%s","n":"%s","e":"%s"}]}`, kid, n, e)
+	}))
+	defer jwks.Close()
+
+	cfg.Cfg.ExtraJwtIssuers = []cfg.ExtraJwtIssuer{{
+		Issuer:   "https://idp.example.com",
+		Audience: "my-api",
+		JWKSURI:  jwks.URL,
+	}}
+	configureExtraJwtIssuers()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   "https://idp.example.com",
+		"aud":   "my-api",
+		"email": "alice@example.com",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := claimsFromExternalJWT(signed)
+	if err != nil {
+		t.Fatalf("claimsFromExternalJWT returned error: %s", err)
+	}
+	if claims.Username != "alice@example.com" {
+		t.Errorf("expected username alice@example.com, got %s", claims.Username)
+	}
+	if !isExternallyIssued(claims) {
+		t.Error("expected claims to be marked as externally issued")
+	}
+}
+
+func TestClaimsFromExternalJWTRejectsUnknownIssuer(t *testing.T) {
+	log = zap.NewNop().Sugar()
+	cfg.Cfg.ExtraJwtIssuers = nil
+	configureExtraJwtIssuers()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": "https://unknown.example.com"})
+	signed, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := claimsFromExternalJWT(signed); err == nil {
+		t.Error("expected an error validating a token from an unconfigured issuer")
+	}
+}
+
+func TestClaimsFromExternalJWTRejectsBadAudience(t *testing.T) {
+	log = zap.NewNop().Sugar()
+
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := "test-kid-2"
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := base64.RawURLEncoding.EncodeToString(priv.PublicKey.N.Bytes())
+		e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(priv.PublicKey.E)).Bytes())
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"keys":[{"kty":"RSA","kid":"%s","n":"%s","e":"%s"}]}`, kid, n, e)
+	}))
+	defer jwks.Close()
+
+	cfg.Cfg.ExtraJwtIssuers = []cfg.ExtraJwtIssuer{{
+		Issuer:   "https://idp.example.com",
+		Audience: "expected-audience",
+		JWKSURI:  jwks.URL,
+	}}
+	configureExtraJwtIssuers()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   "https://idp.example.com",
+		"aud":   "wrong-audience",
+		"email": "alice@example.com",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := claimsFromExternalJWT(signed); err == nil {
+		t.Error("expected an error validating a token with the wrong audience")
+	}
+}
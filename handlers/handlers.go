@@ -15,7 +15,9 @@ import (
 	"github.com/vouch/vouch-proxy/handlers/google"
 	"github.com/vouch/vouch-proxy/handlers/homeassistant"
 	"github.com/vouch/vouch-proxy/handlers/indieauth"
+	"github.com/vouch/vouch-proxy/handlers/keycloak"
 	"github.com/vouch/vouch-proxy/handlers/nextcloud"
+	"github.com/vouch/vouch-proxy/handlers/oauth2server"
 	"github.com/vouch/vouch-proxy/handlers/openid"
 	"github.com/vouch/vouch-proxy/handlers/openstax"
 
@@ -77,6 +79,39 @@ func Configure() {
 
 	provider = getProvider()
 	provider.Configure()
+
+	configureExtraJwtIssuers()
+	oauth2server.Configure()
+	http.HandleFunc("/oauth2/authorize", OAuth2AuthorizeHandler)
+
+	switch cfg.GenOAuth.Provider {
+	case cfg.Providers.GitHub:
+		if cfg.Cfg.RequireVerifiedEmail {
+			registerAuthorizer(githubVerifiedEmailAuthorizer{})
+		}
+	case cfg.Providers.Google:
+		if cfg.Cfg.GoogleServiceAccountJSON != "" {
+			registerAuthorizer(googleGroupAuthorizer{})
+		}
+	}
+}
+
+// OAuth2AuthorizeHandler /oauth2/authorize
+// requires the caller to already hold a valid Vouch session; it bridges
+// handlers' cookie/jwt-based auth into oauth2server's authorization-code
+// flow so nginx-fronted apps and native OAuth2 apps share a single login
+func OAuth2AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	jwt := FindJWT(r)
+	if jwt == "" {
+		error401na(w, r)
+		return
+	}
+	claims, err := ClaimsFromJWT(jwt)
+	if err != nil || claims.Username == "" {
+		error401na(w, r)
+		return
+	}
+	oauth2server.AuthorizeHandler(w, r, claims.Username, claims.CustomClaims)
 }
 
 func loginURL(r *http.Request, state string) string {
@@ -138,11 +173,19 @@ func FindJWT(r *http.Request) string {
 }
 
 // ClaimsFromJWT parse the jwt and return the claims
+// if the jwt isn't a Vouch-issued token, fall back to validating it against
+// the configured ExtraJwtIssuers (see externaljwt.go) so that externally
+// issued bearer tokens can be accepted without the interactive login flow
 func ClaimsFromJWT(jwt string) (jwtmanager.VouchClaims, error) {
 	var claims jwtmanager.VouchClaims
 
 	jwtParsed, err := jwtmanager.ParseTokenString(jwt)
 	if err != nil {
+		// it didn't parse as a Vouch token, see if it matches one of the
+		// trusted external issuers before giving up
+		if extClaims, extErr := claimsFromExternalJWT(jwt); extErr == nil {
+			return extClaims, nil
+		}
 		// it didn't parse, which means its bad, start over
 		log.Error("jwtParsed returned error, clearing cookie")
 		return claims, err
@@ -202,7 +245,16 @@ func ValidateRequestHandler(w http.ResponseWriter, r *http.Request) {
 	fastlog.Info("jwt cookie",
 		zap.String("username", claims.Username))
 
-	if !cfg.Cfg.AllowAllUsers {
+	if refreshed, ok := maybeRefreshJWT(w, r, claims); ok {
+		claims = refreshed
+	}
+
+	// a token validated against one of cfg.Cfg.ExtraJwtIssuers was never
+	// minted by Vouch for a particular `vouch.domains` entry, so it carries
+	// no site data for SiteInClaims to check - its issuer/audience check
+	// (already enforced in claimsFromExternalJWT) is its authorization
+	// boundary instead
+	if !cfg.Cfg.AllowAllUsers && !isExternallyIssued(claims) {
 		if !jwtmanager.SiteInClaims(r.Host, &claims) {
 			if !cfg.Cfg.PublicAccess {
 				error401(w, r, AuthError{
@@ -294,6 +346,12 @@ func ValidateRequestHandler(w http.ResponseWriter, r *http.Request) {
 // currently performs a 302 redirect to Google
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debug("/logout")
+
+	// revoke any server-side refresh session for this jwt before clearing
+	// the cookie, so the provider refresh token it holds can no longer be
+	// used by maybeRefreshJWT to silently re-issue a new one
+	deleteRefreshSession(r)
+
 	cookie.ClearCookie(w, r)
 
 	log.Debug("deleting session")
@@ -403,11 +461,20 @@ func renderIndex(w http.ResponseWriter, msg string) {
 	}
 }
 
-// VerifyUser validates that the domains match for the user
-func VerifyUser(u interface{}) (bool, error) {
+// VerifyUser validates that the domains match for the user, after first
+// running the chain of registered Authorizers (see authorizer.go), which
+// may themselves reject the login or populate fields such as
+// TeamMemberships that the switch below then evaluates
+func VerifyUser(u interface{}, ptokens structs.PTokens) (bool, error) {
 
 	user := u.(structs.User)
 
+	for _, a := range authorizers {
+		if ok, err := a.Authorize(&user, ptokens); !ok {
+			return false, err
+		}
+	}
+
 	switch {
 
 	// AllowAllUsers
@@ -499,7 +566,7 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debugf("/auth %+v", user)
 	log.Debugf("requestedURL %v", session.Values["requestedURL"].(string))
 
-	if ok, err := VerifyUser(user); !ok {
+	if ok, err := VerifyUser(user, ptokens); !ok {
 		log.Error(err)
 //		renderIndex(w, fmt.Sprintf("/auth User is not authorized. %s Please try again.", err))
                 requestedURL := session.Values["requestedURL"].(string)
@@ -514,6 +581,11 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 
 	// SUCCESS!! they are authorized
 
+	// if the provider issued a refresh_token and oauth.refresh_tokens is
+	// enabled, stash it so ValidateRequestHandler can silently re-issue the
+	// jwt later instead of bouncing back to the interactive login flow
+	persistRefreshSession(user, ptokens, customClaims)
+
 	// issue the jwt
 	tokenstring := jwtmanager.CreateUserTokenString(user, customClaims, ptokens)
 	cookie.SetCookie(w, r, tokenstring)
@@ -553,6 +625,8 @@ func getProvider() Provider {
 		return google.Provider{}
 	case cfg.Providers.GitHub:
 		return github.Provider{PrepareTokensAndClient: common.PrepareTokensAndClient}
+	case cfg.Providers.Keycloak:
+		return keycloak.Provider{PrepareTokensAndClient: common.PrepareTokensAndClient}
 	case cfg.Providers.Nextcloud:
 		return nextcloud.Provider{}
 	case cfg.Providers.OIDC:
@@ -0,0 +1,89 @@
+// Package keycloak is the handlers.Provider implementation for Keycloak,
+// see https://www.keycloak.org/docs-api/latest/rest-api/index.html#_userinfo
+package keycloak
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/vouch/vouch-proxy/handlers/common"
+	"github.com/vouch/vouch-proxy/pkg/cfg"
+	"github.com/vouch/vouch-proxy/pkg/structs"
+	"go.uber.org/zap"
+)
+
+var log *zap.SugaredLogger
+
+// Provider is the keycloak handlers.Provider implementation
+type Provider struct {
+	PrepareTokensAndClient func(r *http.Request, ptokens *structs.PTokens, json bool, userinfoURL string) (*http.Client, error)
+}
+
+// userInfoResponse is the subset of the Keycloak userinfo response vouch needs
+type userInfoResponse struct {
+	Sub               string                     `json:"sub"`
+	Email             string                     `json:"email"`
+	PreferredUsername string                     `json:"preferred_username"`
+	RealmAccess       realmAccess                `json:"realm_access"`
+	ResourceAccess    map[string]resourceAccess  `json:"resource_access"`
+}
+
+type realmAccess struct {
+	Roles []string `json:"roles"`
+}
+
+type resourceAccess struct {
+	Roles []string `json:"roles"`
+}
+
+// Configure see main.go configure()
+func (p Provider) Configure() {
+	log = cfg.Logging.Logger
+}
+
+// GetUserInfo calls the Keycloak userinfo endpoint and populates
+// structs.User, including TeamMemberships built from realm_access.roles and
+// resource_access.<client>.roles so TeamWhiteList entries of the form
+// "myclient:admin" or "realm:developer" work as expected
+func (p Provider) GetUserInfo(r *http.Request, user *structs.User, customClaims *structs.CustomClaims, ptokens *structs.PTokens) error {
+	client, err := p.PrepareTokensAndClient(r, ptokens, true, cfg.GenOAuth.UserInfoURL)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Get(cfg.GenOAuth.UserInfoURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("keycloak: userinfo endpoint returned %s: %s", resp.Status, body)
+	}
+
+	var info userInfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return fmt.Errorf("keycloak: error decoding userinfo response: %w", err)
+	}
+
+	user.Username = info.PreferredUsername
+	user.Email = info.Email
+
+	var teams []string
+	for _, role := range info.RealmAccess.Roles {
+		teams = append(teams, fmt.Sprintf("realm:%s", role))
+	}
+	for clientID, access := range info.ResourceAccess {
+		for _, role := range access.Roles {
+			teams = append(teams, fmt.Sprintf("%s:%s", clientID, role))
+		}
+	}
+	user.TeamMemberships = teams
+
+	log.Debugf("keycloak: found user %s with teams %s", user.Username, strings.Join(teams, ", "))
+	return nil
+}
@@ -0,0 +1,99 @@
+package keycloak
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/vouch/vouch-proxy/pkg/cfg"
+	"github.com/vouch/vouch-proxy/pkg/structs"
+	"go.uber.org/zap"
+)
+
+func TestGetUserInfo(t *testing.T) {
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"sub": "abc-123",
+			"email": "test@example.com",
+			"preferred_username": "testuser",
+			"realm_access": {"roles": ["developer"]},
+			"resource_access": {
+				"myclient": {"roles": ["admin"]}
+			}
+		}`))
+	}))
+	defer mock.Close()
+
+	cfg.GenOAuth.UserInfoURL = mock.URL
+
+	p := Provider{
+		PrepareTokensAndClient: func(r *http.Request, ptokens *structs.PTokens, asJSON bool, userinfoURL string) (*http.Client, error) {
+			return mock.Client(), nil
+		},
+	}
+
+	user := structs.User{}
+	customClaims := structs.CustomClaims{}
+	ptokens := structs.PTokens{}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	log = zap.NewNop().Sugar()
+
+	if err := p.GetUserInfo(req, &user, &customClaims, &ptokens); err != nil {
+		t.Fatalf("GetUserInfo returned error: %s", err)
+	}
+
+	if user.Username != "testuser" {
+		t.Errorf("expected username testuser, got %s", user.Username)
+	}
+	if user.Email != "test@example.com" {
+		t.Errorf("expected email test@example.com, got %s", user.Email)
+	}
+
+	teams := append([]string{}, user.TeamMemberships...)
+	sort.Strings(teams)
+	want := []string{"myclient:admin", "realm:developer"}
+	if len(teams) != len(want) {
+		t.Fatalf("expected teams %v, got %v", want, teams)
+	}
+	for i := range want {
+		if teams[i] != want[i] {
+			t.Errorf("expected teams %v, got %v", want, teams)
+			break
+		}
+	}
+}
+
+func TestGetUserInfoRejectsNon200Response(t *testing.T) {
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid_token"}`))
+	}))
+	defer mock.Close()
+
+	cfg.GenOAuth.UserInfoURL = mock.URL
+
+	p := Provider{
+		PrepareTokensAndClient: func(r *http.Request, ptokens *structs.PTokens, asJSON bool, userinfoURL string) (*http.Client, error) {
+			return mock.Client(), nil
+		},
+	}
+
+	user := structs.User{}
+	customClaims := structs.CustomClaims{}
+	ptokens := structs.PTokens{}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	log = zap.NewNop().Sugar()
+
+	err := p.GetUserInfo(req, &user, &customClaims, &ptokens)
+	if err == nil {
+		t.Fatal("expected GetUserInfo to return an error for a non-200 userinfo response")
+	}
+	if user.Username != "" {
+		t.Errorf("expected no username to be set on a failed lookup, got %s", user.Username)
+	}
+}
@@ -0,0 +1,300 @@
+// Package oauth2server turns Vouch into a downstream OAuth2/OIDC
+// authorization server (authorization-code + mandatory PKCE), so native
+// apps can delegate login to Vouch directly.
+package oauth2server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	securerandom "github.com/theckman/go-securerandom"
+	"github.com/vouch/vouch-proxy/pkg/cfg"
+	"github.com/vouch/vouch-proxy/pkg/jwtmanager"
+	"github.com/vouch/vouch-proxy/pkg/structs"
+	"go.uber.org/zap"
+)
+
+var log *zap.SugaredLogger
+
+// codeLifetime is how long an issued authorization code remains valid and
+// unused before it expires, per the request's default of 60s
+const codeLifetime = 60 * time.Second
+
+// authCode is a single-use authorization code, held only in memory: losing
+// it on restart just forces the client to redo the authorize step
+type authCode struct {
+	clientID      string
+	redirectURI   string
+	scope         string
+	codeChallenge string
+	username      string
+	customClaims  structs.CustomClaims
+	expires       time.Time
+	used          bool
+}
+
+var (
+	codesMu sync.Mutex
+	codes   = map[string]*authCode{}
+)
+
+// Configure see main.go configure()
+//
+// /oauth2/authorize is bridged through handlers.OAuth2AuthorizeHandler,
+// which handlers.Configure registers on http.DefaultServeMux right after
+// calling this Configure (it needs handlers' cookie/jwt session to resolve
+// the calling user before reaching AuthorizeHandler). The remaining
+// endpoints below need no such bridging, so Configure registers them
+// directly on http.DefaultServeMux.
+func Configure() {
+	log = cfg.Logging.Logger
+
+	http.HandleFunc("/oauth2/token", TokenHandler)
+	http.HandleFunc("/oauth2/userinfo", UserinfoHandler)
+	http.HandleFunc("/.well-known/openid-configuration", DiscoveryHandler)
+}
+
+func clientByID(clientID string) (cfg.OAuth2ServerClient, bool) {
+	for _, c := range cfg.Cfg.OAuth2Server.Clients {
+		if c.ClientID == clientID {
+			return c, true
+		}
+	}
+	return cfg.OAuth2ServerClient{}, false
+}
+
+func redirectURIAllowed(client cfg.OAuth2ServerClient, redirectURI string) bool {
+	for _, allowed := range client.RedirectURIs {
+		// exact match only: no substring matching, no wildcards
+		if subtle.ConstantTimeCompare([]byte(allowed), []byte(redirectURI)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeAllowed reports whether every space-separated value in the
+// requested scope is present in client.AllowedScopes
+func scopeAllowed(client cfg.OAuth2ServerClient, requestedScope string) bool {
+	if requestedScope == "" {
+		return true
+	}
+	allowed := make(map[string]bool, len(client.AllowedScopes))
+	for _, s := range client.AllowedScopes {
+		allowed[s] = true
+	}
+	for _, s := range strings.Fields(requestedScope) {
+		if !allowed[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// AuthorizeHandler /oauth2/authorize
+// requires the caller to already hold a valid Vouch session (cookie or
+// bearer jwt); callers without one should be sent through /login first.
+// customClaims is the already-authenticated session's claims, carried
+// through to the code so TokenHandler can filter it per client.ClaimAllowList
+// without needing to re-derive claims for username on its own.
+func AuthorizeHandler(w http.ResponseWriter, r *http.Request, username string, customClaims structs.CustomClaims) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" {
+		http.Error(w, "unsupported_response_type", http.StatusBadRequest)
+		return
+	}
+
+	clientID := q.Get("client_id")
+	client, ok := clientByID(clientID)
+	if !ok {
+		http.Error(w, "invalid_client", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI := q.Get("redirect_uri")
+	if !redirectURIAllowed(client, redirectURI) {
+		log.Errorf("oauth2server: redirect_uri %s is not registered for client %s", redirectURI, clientID)
+		http.Error(w, "invalid_redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "code_challenge (S256) is required", http.StatusBadRequest)
+		return
+	}
+
+	scope := q.Get("scope")
+	if !scopeAllowed(client, scope) {
+		log.Errorf("oauth2server: scope %q requested by client %s exceeds its allowed_scopes", scope, clientID)
+		http.Error(w, "invalid_scope", http.StatusBadRequest)
+		return
+	}
+
+	code, err := securerandom.URLBase64InBytes(32)
+	if err != nil {
+		http.Error(w, "server_error", http.StatusInternalServerError)
+		return
+	}
+
+	codesMu.Lock()
+	codes[code] = &authCode{
+		clientID:      clientID,
+		redirectURI:   redirectURI,
+		scope:         scope,
+		codeChallenge: q.Get("code_challenge"),
+		username:      username,
+		customClaims:  customClaims,
+		expires:       time.Now().Add(codeLifetime),
+	}
+	codesMu.Unlock()
+
+	dest := fmt.Sprintf("%s?code=%s", redirectURI, code)
+	if state := q.Get("state"); state != "" {
+		dest += "&state=" + state
+	}
+	http.Redirect(w, r, dest, http.StatusFound)
+}
+
+// TokenHandler /oauth2/token signs the access/id token with
+// jwtmanager.CreateUserTokenString, the same HMAC-signed Vouch JWT used for
+// the session cookie - there is no separate per-client signing key, so the
+// token can only be validated by Vouch itself (via UserinfoHandler), not by
+// the client directly
+func TokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("grant_type") != "authorization_code" {
+		http.Error(w, "unsupported_grant_type", http.StatusBadRequest)
+		return
+	}
+
+	code := r.FormValue("code")
+	codesMu.Lock()
+	ac, ok := codes[code]
+	if ok {
+		delete(codes, code) // single-use: remove regardless of outcome below
+	}
+	codesMu.Unlock()
+
+	if !ok || ac.used || time.Now().After(ac.expires) {
+		http.Error(w, "invalid_grant", http.StatusBadRequest)
+		return
+	}
+	ac.used = true
+
+	clientID := r.FormValue("client_id")
+	if clientID != ac.clientID {
+		http.Error(w, "invalid_grant", http.StatusBadRequest)
+		return
+	}
+	client, ok := clientByID(clientID)
+	if !ok {
+		http.Error(w, "invalid_client", http.StatusBadRequest)
+		return
+	}
+
+	if r.FormValue("redirect_uri") != ac.redirectURI {
+		http.Error(w, "invalid_grant", http.StatusBadRequest)
+		return
+	}
+
+	if !verifyPKCE(ac.codeChallenge, r.FormValue("code_verifier")) {
+		http.Error(w, "invalid_grant: pkce verification failed", http.StatusBadRequest)
+		return
+	}
+
+	user := structs.User{Username: ac.username}
+	tokenstring := jwtmanager.CreateUserTokenString(user, allowedClaims(client, ac.customClaims), structs.PTokens{})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": tokenstring,
+		"id_token":     tokenstring,
+		"token_type":   "Bearer",
+		"scope":        ac.scope,
+	})
+}
+
+// UserinfoHandler /oauth2/userinfo validates the bearer access token with
+// jwtmanager.ParseTokenString and jwtmanager.PTokenClaims, the same steps
+// handlers.ClaimsFromJWT uses for a Vouch-issued token, so access tokens
+// issued above are accepted. It does not call handlers.ClaimsFromJWT itself,
+// so tokens from cfg.Cfg.ExtraJwtIssuers are not accepted here.
+func UserinfoHandler(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(auth) <= len(prefix) || auth[:len(prefix)] != prefix {
+		http.Error(w, "no bearer token found", http.StatusUnauthorized)
+		return
+	}
+	jwtParsed, err := jwtmanager.ParseTokenString(auth[len(prefix):])
+	if err != nil {
+		http.Error(w, "invalid_token", http.StatusUnauthorized)
+		return
+	}
+	claims, err := jwtmanager.PTokenClaims(jwtParsed)
+	if err != nil {
+		http.Error(w, "invalid_token", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"sub":    claims.Username,
+		"claims": claims.CustomClaims,
+	})
+}
+
+// DiscoveryHandler /.well-known/openid-configuration
+//
+// There's no jwks_uri: id_tokens are signed with Vouch's shared HMAC
+// session secret, same as the cookie jwt, so there is no public key to
+// publish - publishing it would hand out the secret Vouch trusts to mint
+// sessions. Clients verify a token by calling userinfo_endpoint instead.
+func DiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	base := cfg.Cfg.OAuth2Server.Issuer
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                base,
+		"authorization_endpoint":                base + "/oauth2/authorize",
+		"token_endpoint":                        base + "/oauth2/token",
+		"userinfo_endpoint":                     base + "/oauth2/userinfo",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"HS256"},
+	})
+}
+
+func allowedClaims(client cfg.OAuth2ServerClient, all structs.CustomClaims) structs.CustomClaims {
+	if len(client.ClaimAllowList) == 0 {
+		return all
+	}
+	filtered := structs.CustomClaims{}
+	for _, k := range client.ClaimAllowList {
+		if v, ok := all[k]; ok {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+func verifyPKCE(codeChallenge, codeVerifier string) bool {
+	if codeVerifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(codeVerifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(codeChallenge)) == 1
+}
@@ -0,0 +1,135 @@
+package oauth2server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vouch/vouch-proxy/pkg/cfg"
+	"go.uber.org/zap"
+)
+
+func testClient() cfg.OAuth2ServerClient {
+	return cfg.OAuth2ServerClient{
+		ClientID:      "testclient",
+		RedirectURIs:  []string{"https://app.example.com/callback"},
+		AllowedScopes: []string{"openid", "profile"},
+	}
+}
+
+func TestScopeAllowed(t *testing.T) {
+	client := testClient()
+
+	cases := []struct {
+		scope string
+		want  bool
+	}{
+		{"", true},
+		{"openid", true},
+		{"openid profile", true},
+		{"openid admin", false},
+		{"admin", false},
+	}
+	for _, c := range cases {
+		if got := scopeAllowed(client, c.scope); got != c.want {
+			t.Errorf("scopeAllowed(%q) = %v, want %v", c.scope, got, c.want)
+		}
+	}
+}
+
+func TestRedirectURIAllowedIsExactMatchOnly(t *testing.T) {
+	client := testClient()
+
+	cases := []struct {
+		uri  string
+		want bool
+	}{
+		{"https://app.example.com/callback", true},
+		{"https://app.example.com/callback/", false},
+		{"https://app.example.com/callback?x=1", false},
+		{"https://evil.example.com/callback", false},
+		{"https://app.example.com/callback.evil.com", false},
+	}
+	for _, c := range cases {
+		if got := redirectURIAllowed(client, c.uri); got != c.want {
+			t.Errorf("redirectURIAllowed(%q) = %v, want %v", c.uri, got, c.want)
+		}
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	verifier := "a-fairly-long-random-code-verifier-value"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	if !verifyPKCE(challenge, verifier) {
+		t.Error("expected matching verifier/challenge to pass")
+	}
+	if verifyPKCE(challenge, "wrong-verifier") {
+		t.Error("expected mismatched verifier to fail")
+	}
+	if verifyPKCE(challenge, "") {
+		t.Error("expected empty verifier to fail")
+	}
+}
+
+func authorizeRequest(query string) *http.Request {
+	return httptest.NewRequest(http.MethodGet, "/oauth2/authorize?"+query, nil)
+}
+
+func TestAuthorizeHandlerRejectsUnregisteredRedirectURI(t *testing.T) {
+	log = zap.NewNop().Sugar()
+	cfg.Cfg.OAuth2Server.Clients = []cfg.OAuth2ServerClient{testClient()}
+
+	w := httptest.NewRecorder()
+	r := authorizeRequest("response_type=code&client_id=testclient&redirect_uri=https://evil.example.com/callback&code_challenge_method=S256&code_challenge=abc")
+	AuthorizeHandler(w, r, "alice", nil)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unregistered redirect_uri, got %d", w.Code)
+	}
+}
+
+func TestAuthorizeHandlerRequiresS256PKCE(t *testing.T) {
+	log = zap.NewNop().Sugar()
+	cfg.Cfg.OAuth2Server.Clients = []cfg.OAuth2ServerClient{testClient()}
+
+	w := httptest.NewRecorder()
+	r := authorizeRequest("response_type=code&client_id=testclient&redirect_uri=https://app.example.com/callback")
+	AuthorizeHandler(w, r, "alice", nil)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 when code_challenge is missing, got %d", w.Code)
+	}
+}
+
+func TestAuthorizeHandlerRejectsDisallowedScope(t *testing.T) {
+	log = zap.NewNop().Sugar()
+	cfg.Cfg.OAuth2Server.Clients = []cfg.OAuth2ServerClient{testClient()}
+
+	w := httptest.NewRecorder()
+	r := authorizeRequest("response_type=code&client_id=testclient&redirect_uri=https://app.example.com/callback&code_challenge_method=S256&code_challenge=abc&scope=openid+admin")
+	AuthorizeHandler(w, r, "alice", nil)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a scope outside the client's allowed_scopes, got %d", w.Code)
+	}
+}
+
+func TestAuthorizeHandlerIssuesCodeForAllowedRequest(t *testing.T) {
+	log = zap.NewNop().Sugar()
+	cfg.Cfg.OAuth2Server.Clients = []cfg.OAuth2ServerClient{testClient()}
+
+	w := httptest.NewRecorder()
+	r := authorizeRequest("response_type=code&client_id=testclient&redirect_uri=https://app.example.com/callback&code_challenge_method=S256&code_challenge=abc&scope=openid")
+	AuthorizeHandler(w, r, "alice", nil)
+
+	if w.Code != http.StatusFound {
+		t.Errorf("expected a 302 redirect with an issued code, got %d", w.Code)
+	}
+	if loc := w.Header().Get("Location"); loc == "" {
+		t.Error("expected a Location header carrying the authorization code")
+	}
+}
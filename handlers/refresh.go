@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/vouch/vouch-proxy/pkg/cfg"
+	"github.com/vouch/vouch-proxy/pkg/cookie"
+	"github.com/vouch/vouch-proxy/pkg/jwtmanager"
+	"github.com/vouch/vouch-proxy/pkg/refreshstore"
+	"github.com/vouch/vouch-proxy/pkg/structs"
+	"golang.org/x/oauth2"
+)
+
+// refreshSessionClaim is the custom claim name used to embed the
+// refreshstore session id inside the Vouch JWT
+const refreshSessionClaim = "vouchRefreshSessionID"
+
+// persistRefreshSession saves ptokens.PRefreshToken in the refreshstore and
+// records the new session id under refreshSessionClaim in customClaims,
+// anchoring the session's max lifetime to this login. It does nothing unless
+// oauth.refresh_tokens is enabled and the provider issued a refresh token.
+func persistRefreshSession(user structs.User, ptokens structs.PTokens, customClaims structs.CustomClaims) {
+	if !cfg.GenOAuth.RefreshTokens || ptokens.PRefreshToken == "" {
+		return
+	}
+	persistRefreshSessionUntil(user, ptokens, customClaims, time.Now().Add(cfg.Cfg.Session.MaxSessionLifetime))
+}
+
+// persistRefreshSessionUntil is persistRefreshSession with an explicit cap
+func persistRefreshSessionUntil(user structs.User, ptokens structs.PTokens, customClaims structs.CustomClaims, expires time.Time) {
+	sessionID, err := generateStateNonce()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	session := refreshstore.Session{
+		RefreshToken: ptokens.PRefreshToken,
+		Provider:     cfg.GenOAuth.Provider,
+		Username:     user.Username,
+		Expires:      expires,
+	}
+	if err := refreshstore.Get().Save(sessionID, session); err != nil {
+		log.Errorf("refresh: unable to persist refresh session: %s", err)
+		return
+	}
+	customClaims[refreshSessionClaim] = sessionID
+}
+
+// deleteRefreshSession revokes the refreshstore session attached to r's
+// current jwt, if any
+func deleteRefreshSession(r *http.Request) {
+	jwt := FindJWT(r)
+	if jwt == "" {
+		return
+	}
+	claims, err := ClaimsFromJWT(jwt)
+	if err != nil {
+		return
+	}
+	sessionID, ok := claims.CustomClaims[refreshSessionClaim].(string)
+	if !ok || sessionID == "" {
+		return
+	}
+	if err := refreshstore.Get().Delete(sessionID); err != nil {
+		log.Errorf("refresh: unable to delete refresh session %s on logout: %s", sessionID, err)
+	}
+}
+
+// maybeRefreshJWT transparently re-issues claims' Vouch JWT when it is
+// within cfg.Cfg.Session.RefreshWindow of expiring (or already expired) and
+// a still-valid refreshstore session exists for it. On success it sets the
+// new cookie on w and returns the refreshed claims
+func maybeRefreshJWT(w http.ResponseWriter, r *http.Request, claims jwtmanager.VouchClaims) (jwtmanager.VouchClaims, bool) {
+	if cfg.Cfg.Session.RefreshWindow <= 0 {
+		return claims, false
+	}
+
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	if time.Until(expiresAt) > cfg.Cfg.Session.RefreshWindow {
+		return claims, false
+	}
+
+	sessionID, ok := claims.CustomClaims[refreshSessionClaim].(string)
+	if !ok || sessionID == "" {
+		return claims, false
+	}
+
+	session, ok, err := refreshstore.Get().Get(sessionID)
+	if err != nil {
+		log.Errorf("refresh: error loading refresh session %s: %s", sessionID, err)
+		return claims, false
+	}
+	if !ok {
+		log.Debugf("refresh: no valid refresh session %s, falling through to interactive login", sessionID)
+		return claims, false
+	}
+
+	token, err := cfg.OAuthClient.TokenSource(r.Context(), &oauth2.Token{RefreshToken: session.RefreshToken}).Token()
+	if err != nil {
+		log.Errorf("refresh: unable to redeem refresh token for %s: %s", session.Username, err)
+		return claims, false
+	}
+
+	user := structs.User{Username: session.Username}
+	customClaims := structs.CustomClaims{}
+	ptokens := structs.PTokens{PAccessToken: token.AccessToken, PIdToken: fmt.Sprint(token.Extra("id_token"))}
+	if err := getUserInfo(r, &user, &customClaims, &ptokens); err != nil {
+		log.Errorf("refresh: unable to re-verify user during silent refresh: %s", err)
+		return claims, false
+	}
+	// re-run the same WhiteList/TeamWhiteList/Domains + Authorizer chain used
+	// for the interactive login, so a silent refresh can't re-authorize a
+	// user who would now be rejected (e.g. removed from a TeamWhiteList, or
+	// failing a GitHub verified-email / Google Groups Authorizer check)
+	if ok, err := VerifyUser(user, ptokens); !ok {
+		log.Errorf("refresh: user no longer authorized during silent refresh: %s", err)
+		return claims, false
+	}
+
+	// the refresh session is replaced wholesale below (a fresh session id is
+	// minted either way), so the old one must be explicitly dropped -
+	// otherwise it would sit in the store, still redeemable, until it
+	// separately expired on its own
+	if err := refreshstore.Get().Delete(sessionID); err != nil {
+		log.Errorf("refresh: unable to delete superseded refresh session %s: %s", sessionID, err)
+	}
+
+	if token.RefreshToken != "" {
+		ptokens.PRefreshToken = token.RefreshToken
+	} else {
+		// the provider didn't rotate the refresh token; keep reusing the one
+		// we already had
+		ptokens.PRefreshToken = session.RefreshToken
+	}
+	// session.Expires, not time.Now().Add(MaxSessionLifetime): the max
+	// lifetime is bounded from the original login, so a session that's kept
+	// alive purely by repeated silent refreshes still expires on schedule
+	persistRefreshSessionUntil(user, ptokens, customClaims, session.Expires)
+
+	tokenstring := jwtmanager.CreateUserTokenString(user, customClaims, ptokens)
+	cookie.SetCookie(w, r, tokenstring)
+
+	newClaims, err := ClaimsFromJWT(tokenstring)
+	if err != nil {
+		log.Error(err)
+		return claims, false
+	}
+	log.Debugf("refresh: silently refreshed jwt for %s", user.Username)
+	return newClaims, true
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vouch/vouch-proxy/pkg/cfg"
+	"github.com/vouch/vouch-proxy/pkg/refreshstore"
+	"github.com/vouch/vouch-proxy/pkg/structs"
+	"go.uber.org/zap"
+)
+
+func TestPersistRefreshSessionAnchorsToMaxSessionLifetime(t *testing.T) {
+	cfg.GenOAuth.RefreshTokens = true
+	cfg.Cfg.Session.MaxSessionLifetime = time.Hour
+
+	user := structs.User{Username: "alice"}
+	ptokens := structs.PTokens{PRefreshToken: "original-refresh-token"}
+	customClaims := structs.CustomClaims{}
+
+	persistRefreshSession(user, ptokens, customClaims)
+
+	sessionID, ok := customClaims[refreshSessionClaim].(string)
+	if !ok || sessionID == "" {
+		t.Fatalf("expected persistRefreshSession to set %s in customClaims", refreshSessionClaim)
+	}
+
+	session, ok, err := refreshstore.Get().Get(sessionID)
+	if err != nil || !ok {
+		t.Fatalf("expected a saved refresh session, got ok=%v err=%v", ok, err)
+	}
+
+	wantExpires := time.Now().Add(cfg.Cfg.Session.MaxSessionLifetime)
+	if diff := wantExpires.Sub(session.Expires); diff < -time.Second || diff > time.Second {
+		t.Errorf("expected Expires ~%s, got %s", wantExpires, session.Expires)
+	}
+}
+
+// TestPersistRefreshSessionUntilPreservesOriginalExpiry guards the bug fixed
+// in f88b45a: maybeRefreshJWT must carry the original login's Expires
+// forward across a silent refresh instead of recomputing
+// time.Now().Add(MaxSessionLifetime), or a session kept alive purely by
+// repeated refreshes would renew itself forever.
+func TestPersistRefreshSessionUntilPreservesOriginalExpiry(t *testing.T) {
+	cfg.GenOAuth.RefreshTokens = true
+	cfg.Cfg.Session.MaxSessionLifetime = time.Hour
+
+	user := structs.User{Username: "bob"}
+	ptokens := structs.PTokens{PRefreshToken: "rotated-refresh-token"}
+	customClaims := structs.CustomClaims{}
+
+	originalExpiry := time.Now().Add(5 * time.Minute) // well short of a fresh MaxSessionLifetime window
+	persistRefreshSessionUntil(user, ptokens, customClaims, originalExpiry)
+
+	sessionID, ok := customClaims[refreshSessionClaim].(string)
+	if !ok || sessionID == "" {
+		t.Fatalf("expected persistRefreshSessionUntil to set %s in customClaims", refreshSessionClaim)
+	}
+
+	session, ok, err := refreshstore.Get().Get(sessionID)
+	if err != nil || !ok {
+		t.Fatalf("expected a saved refresh session, got ok=%v err=%v", ok, err)
+	}
+
+	if !session.Expires.Equal(originalExpiry) {
+		t.Errorf("expected Expires to equal the passed-in originalExpiry %s, got %s (would renew past the configured cap)", originalExpiry, session.Expires)
+	}
+}
+
+func TestDeleteRefreshSessionNoopsWithoutJWT(t *testing.T) {
+	log = zap.NewNop().Sugar()
+	req := httptest.NewRequest(http.MethodGet, "/logout", nil)
+	// should not panic and should be a no-op when the request carries no jwt
+	deleteRefreshSession(req)
+}
@@ -0,0 +1,205 @@
+// Package cfg holds vouch-proxy's parsed configuration. Values are
+// populated from the `vouch.yml` config file (see README) at startup; the
+// mapstructure tags below are the yaml keys under each section.
+package cfg
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// RootDir is the absolute path vouch-proxy was launched from; templates and
+// other on-disk assets are resolved relative to it
+var RootDir string
+
+// Cfg is the parsed `vouch:` configuration section
+var Cfg = &Config{}
+
+// GenOAuth is the parsed `oauth:` configuration section
+var GenOAuth = &OAuthConfig{}
+
+// OAuthClient is the oauth2.Config built from GenOAuth at Configure() time
+var OAuthClient *oauth2.Config
+
+// OAuthopts carries any additional AuthCodeOption required by the
+// configured provider (ADFS, for example)
+var OAuthopts oauth2.AuthCodeOption
+
+// Branding holds the cosmetic, white-label strings shown in rendered pages
+var Branding = &BrandingConfig{CcName: "Vouch"}
+
+// Logging holds the configured zap loggers
+var Logging = &LoggingConfig{}
+
+// Providers enumerates the supported oauth.provider values
+var Providers = &providerNames{
+	IndieAuth:     "indieauth",
+	ADFS:          "adfs",
+	HomeAssistant: "homeassistant",
+	OpenStax:      "openstax",
+	Google:        "google",
+	GitHub:        "github",
+	Keycloak:      "keycloak",
+	Nextcloud:     "nextcloud",
+	OIDC:          "oidc",
+}
+
+type providerNames struct {
+	IndieAuth     string
+	ADFS          string
+	HomeAssistant string
+	OpenStax      string
+	Google        string
+	GitHub        string
+	Keycloak      string
+	Nextcloud     string
+	OIDC          string
+}
+
+// LoggingConfig holds the loggers handlers.Configure() copies into its own
+// package-level log/fastlog vars
+type LoggingConfig struct {
+	Logger     *zap.SugaredLogger
+	FastLogger *zap.Logger
+}
+
+// BrandingConfig holds the white-label strings used in error messages
+type BrandingConfig struct {
+	CcName string `mapstructure:"cc_name"`
+}
+
+// OAuthConfig is the `oauth:` section: the generic provider configuration
+// handed to golang.org/x/oauth2 to build OAuthClient
+type OAuthConfig struct {
+	Provider     string   `mapstructure:"provider"`
+	RedirectURLs []string `mapstructure:"callback_urls"`
+	UserInfoURL  string   `mapstructure:"user_info_url"`
+
+	// RefreshTokens opts this provider in to the silent-refresh behavior in
+	// handlers/refresh.go; not every provider issues a refresh_token, so
+	// this must be enabled explicitly
+	RefreshTokens bool `mapstructure:"refresh_tokens"`
+}
+
+// Config is the `vouch:` section: everything handlers reads to decide
+// whether a user is authorized and how to talk back to nginx
+type Config struct {
+	Testing       bool     `mapstructure:"testing"`
+	TestURLs      []string `mapstructure:"test_url"`
+	PublicAccess  bool     `mapstructure:"publicAccess"`
+	AllowAllUsers bool     `mapstructure:"allowAllUsers"`
+	WhiteList     []string `mapstructure:"whitelist"`
+	TeamWhiteList []string `mapstructure:"teamWhitelist"`
+	Domains       []string `mapstructure:"domains"`
+
+	Session SessionConfig `mapstructure:"session"`
+	Cookie  CookieConfig  `mapstructure:"cookie"`
+	Headers HeadersConfig `mapstructure:"headers"`
+
+	// ExtraJwtIssuers lists externally-issued JWT bearer tokens that
+	// handlers.ClaimsFromJWT will accept in place of a Vouch-issued JWT,
+	// verified against each issuer's own JWKS (see handlers/externaljwt.go)
+	ExtraJwtIssuers []ExtraJwtIssuer `mapstructure:"extra_jwt_issuers"`
+
+	// OAuth2Server configures Vouch's own downstream OAuth2/OIDC
+	// authorization server (see handlers/oauth2server)
+	OAuth2Server OAuth2ServerConfig `mapstructure:"oauth2_server"`
+
+	// RequireVerifiedEmail rejects a GitHub login whose primary email isn't
+	// marked verified (see handlers/authorizer_github.go)
+	RequireVerifiedEmail bool `mapstructure:"requireVerifiedEmail"`
+
+	// GoogleServiceAccountJSON is the path to a domain-wide-delegated
+	// service account credential used to check Google Groups membership
+	// for the Google provider; GoogleAdminEmail is the admin user it
+	// impersonates to call the Admin SDK Directory API (see
+	// handlers/authorizer_google.go)
+	GoogleServiceAccountJSON string `mapstructure:"google_service_account_json"`
+	GoogleAdminEmail         string `mapstructure:"google_admin_email"`
+}
+
+// OAuth2ServerConfig is the `vouch.oauth2_server:` section
+type OAuth2ServerConfig struct {
+	// Issuer is this Vouch instance's own issuer URL, advertised in
+	// /.well-known/openid-configuration
+	Issuer  string               `mapstructure:"issuer"`
+	Clients []OAuth2ServerClient `mapstructure:"clients"`
+}
+
+// OAuth2ServerClient is one registered oauth2_server.clients entry
+type OAuth2ServerClient struct {
+	ClientID     string   `mapstructure:"client_id"`
+	RedirectURIs []string `mapstructure:"redirect_uris"`
+	// AllowedScopes is the set of scope values this client may request;
+	// AuthorizeHandler rejects any requested scope outside this list
+	AllowedScopes []string `mapstructure:"allowed_scopes"`
+	// ClaimAllowList is the set of claim names TokenHandler will include in
+	// the id_token it issues to this client; all claims are included when empty
+	ClaimAllowList []string `mapstructure:"claim_allow_list"`
+}
+
+// ExtraJwtIssuer configures one trusted external JWT issuer. Exactly one of
+// DiscoveryURL or JWKSURI should be set; if only DiscoveryURL is given, the
+// jwks_uri is resolved from that issuer's OpenID discovery document.
+type ExtraJwtIssuer struct {
+	Issuer   string `mapstructure:"issuer"`
+	Audience string `mapstructure:"audience"`
+	// DiscoveryURL is the issuer's OpenID discovery document URL, used to
+	// resolve JWKSURI when it isn't set explicitly
+	DiscoveryURL string `mapstructure:"discovery_url"`
+	JWKSURI      string `mapstructure:"jwks_uri"`
+	// UsernameClaim names the claim mapped into claims.Username, default "email"
+	UsernameClaim string `mapstructure:"username_claim"`
+}
+
+// SessionConfig is the `vouch.session:` section backing the gorilla
+// sessions.CookieStore used for login-flow state (nonce, requestedURL)
+type SessionConfig struct {
+	Name string `mapstructure:"name"`
+	Key  string `mapstructure:"key"`
+
+	// RefreshWindow is how far ahead of jwt expiry handlers.maybeRefreshJWT
+	// will attempt a silent refresh; 0 disables silent refresh entirely
+	RefreshWindow time.Duration `mapstructure:"refresh_window"`
+	// MaxSessionLifetime bounds how long a refresh session may be renewed
+	// for in total, measured from the original login, not from the most
+	// recent refresh
+	MaxSessionLifetime time.Duration `mapstructure:"max_session_lifetime"`
+
+	// RefreshStoreBackend selects the pkg/refreshstore backend: "memory"
+	// (default) or "redis" (requires the `redis` build tag)
+	RefreshStoreBackend string `mapstructure:"refresh_store_backend"`
+	RedisAddr           string `mapstructure:"redis_addr"`
+	RedisPassword       string `mapstructure:"redis_password"`
+	RedisDB             int    `mapstructure:"redis_db"`
+}
+
+// CookieConfig is the `vouch.cookie:` section controlling the Vouch JWT
+// cookie written by pkg/cookie
+type CookieConfig struct {
+	Name     string `mapstructure:"name"`
+	Domain   string `mapstructure:"domain"`
+	MaxAge   int    `mapstructure:"maxage"`
+	Secure   bool   `mapstructure:"secure"`
+	HTTPOnly bool   `mapstructure:"httponly"`
+
+	// MaxChunkSize is the threshold, in bytes, above which pkg/cookie
+	// splits the jwt across VouchCookie_0..VouchCookie_N cookies instead of
+	// writing it as a single cookie. 0 uses pkg/cookie's own default.
+	MaxChunkSize int `mapstructure:"max_chunk_size"`
+}
+
+// HeadersConfig is the `vouch.headers:` section naming the headers Vouch
+// sets on a successful /validate response
+type HeadersConfig struct {
+	JWT           string            `mapstructure:"jwt"`
+	QueryString   string            `mapstructure:"querystring"`
+	User          string            `mapstructure:"user"`
+	Success       string            `mapstructure:"success"`
+	ClaimHeader   string            `mapstructure:"claimheader"`
+	AccessToken   string            `mapstructure:"accesstoken"`
+	IDToken       string            `mapstructure:"idtoken"`
+	ClaimsCleaned map[string]string `mapstructure:"claims"`
+}
@@ -0,0 +1,129 @@
+// Package cookie reads and writes the Vouch session cookie, chunking it
+// across several numbered cookies when it exceeds the configured threshold.
+package cookie
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vouch/vouch-proxy/pkg/cfg"
+)
+
+// defaultChunkThreshold is used when cfg.Cfg.Cookie.MaxChunkSize is unset
+const defaultChunkThreshold = 3800
+
+func cookieName() string {
+	return cfg.Cfg.Cookie.Name
+}
+
+func countCookieName() string {
+	return cookieName() + "_count"
+}
+
+func chunkName(i int) string {
+	return fmt.Sprintf("%s_%d", cookieName(), i)
+}
+
+func chunkThreshold() int {
+	if cfg.Cfg.Cookie.MaxChunkSize > 0 {
+		return cfg.Cfg.Cookie.MaxChunkSize
+	}
+	return defaultChunkThreshold
+}
+
+// SetCookie sets tokenstring as the Vouch session cookie, chunking it across
+// VouchCookie_0..VouchCookie_N if needed. Clears any previously written
+// cookie first so a shrinking jwt doesn't leave stale chunks behind.
+func SetCookie(w http.ResponseWriter, r *http.Request, tokenstring string) {
+	ClearCookie(w, r)
+
+	threshold := chunkThreshold()
+	if len(tokenstring) <= threshold {
+		http.SetCookie(w, newCookie(cookieName(), tokenstring))
+		return
+	}
+
+	var chunks []string
+	for len(tokenstring) > 0 {
+		end := threshold
+		if end > len(tokenstring) {
+			end = len(tokenstring)
+		}
+		chunks = append(chunks, tokenstring[:end])
+		tokenstring = tokenstring[end:]
+	}
+
+	for i, chunk := range chunks {
+		http.SetCookie(w, newCookie(chunkName(i), chunk))
+	}
+	http.SetCookie(w, newCookie(countCookieName(), strconv.Itoa(len(chunks))))
+}
+
+// Cookie reassembles and returns the Vouch session cookie from r, whether
+// it was written as a single cookie or chunked across several
+func Cookie(r *http.Request) (string, error) {
+	if countStr, err := r.Cookie(countCookieName()); err == nil {
+		count, convErr := strconv.Atoi(countStr.Value)
+		if convErr != nil {
+			return "", fmt.Errorf("cookie: invalid chunk count %q", countStr.Value)
+		}
+		var b strings.Builder
+		for i := 0; i < count; i++ {
+			c, err := r.Cookie(chunkName(i))
+			if err != nil {
+				return "", fmt.Errorf("cookie: missing chunk %d of %d", i, count)
+			}
+			b.WriteString(c.Value)
+		}
+		return b.String(), nil
+	}
+
+	c, err := r.Cookie(cookieName())
+	if err != nil {
+		return "", err
+	}
+	return c.Value, nil
+}
+
+// ClearCookie expires the Vouch session cookie, every chunk written for it,
+// and any stale chunks left behind by a previous, larger jwt.
+func ClearCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, expireCookie(cookieName()))
+	http.SetCookie(w, expireCookie(countCookieName()))
+
+	count := 0
+	if countStr, err := r.Cookie(countCookieName()); err == nil {
+		if n, err := strconv.Atoi(countStr.Value); err == nil {
+			count = n
+		}
+	}
+
+	for i := 0; ; i++ {
+		_, err := r.Cookie(chunkName(i))
+		notPresent := err != nil
+		if i >= count && notPresent {
+			break
+		}
+		http.SetCookie(w, expireCookie(chunkName(i)))
+	}
+}
+
+func newCookie(name, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   cfg.Cfg.Cookie.Domain,
+		MaxAge:   cfg.Cfg.Cookie.MaxAge,
+		HttpOnly: cfg.Cfg.Cookie.HTTPOnly,
+		Secure:   cfg.Cfg.Cookie.Secure,
+	}
+}
+
+func expireCookie(name string) *http.Cookie {
+	c := newCookie(name, "")
+	c.MaxAge = -1
+	return c
+}
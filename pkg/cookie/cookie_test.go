@@ -0,0 +1,102 @@
+package cookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vouch/vouch-proxy/pkg/cfg"
+)
+
+func setupTestConfig() {
+	cfg.Cfg.Cookie.Name = "VouchCookie"
+	cfg.Cfg.Cookie.MaxChunkSize = 3800
+}
+
+// requestWithCookiesFrom replays the Set-Cookie headers written to rec onto
+// a new *http.Request, as a browser would on the next call: a later header
+// replaces an earlier one of the same name, and expired cookies are dropped
+func requestWithCookiesFrom(rec *httptest.ResponseRecorder) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	jar := map[string]*http.Cookie{}
+	var order []string
+	for _, c := range rec.Result().Cookies() {
+		if _, seen := jar[c.Name]; !seen {
+			order = append(order, c.Name)
+		}
+		jar[c.Name] = c
+	}
+	for _, name := range order {
+		if c := jar[name]; c.MaxAge >= 0 {
+			r.AddCookie(c)
+		}
+	}
+	return r
+}
+
+func TestSetCookieSmallRoundTrip(t *testing.T) {
+	setupTestConfig()
+	jwt := "a.short.jwt"
+
+	rec := httptest.NewRecorder()
+	SetCookie(rec, httptest.NewRequest(http.MethodGet, "/", nil), jwt)
+
+	got, err := Cookie(requestWithCookiesFrom(rec))
+	if err != nil {
+		t.Fatalf("Cookie() returned error: %s", err)
+	}
+	if got != jwt {
+		t.Errorf("expected %q, got %q", jwt, got)
+	}
+}
+
+func TestSetCookieLargeJWTIsChunkedAndRoundTrips(t *testing.T) {
+	setupTestConfig()
+	jwt := strings.Repeat("x", 20*1024)
+
+	rec := httptest.NewRecorder()
+	SetCookie(rec, httptest.NewRequest(http.MethodGet, "/", nil), jwt)
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) < 6 {
+		t.Fatalf("expected a 20KB jwt to be split into several chunk cookies, got %d cookies", len(cookies))
+	}
+
+	req := requestWithCookiesFrom(rec)
+	got, err := Cookie(req)
+	if err != nil {
+		t.Fatalf("Cookie() returned error: %s", err)
+	}
+	if got != jwt {
+		t.Errorf("round-tripped jwt did not match: got len %d, want len %d", len(got), len(jwt))
+	}
+}
+
+func TestClearCookieExpiresAllChunks(t *testing.T) {
+	setupTestConfig()
+	jwt := strings.Repeat("y", 20*1024)
+
+	setRec := httptest.NewRecorder()
+	SetCookie(setRec, httptest.NewRequest(http.MethodGet, "/", nil), jwt)
+	req := requestWithCookiesFrom(setRec)
+
+	clearRec := httptest.NewRecorder()
+	ClearCookie(clearRec, req)
+
+	for _, c := range clearRec.Result().Cookies() {
+		if c.MaxAge >= 0 {
+			t.Errorf("expected cookie %s to be expired (MaxAge<0), got %d", c.Name, c.MaxAge)
+		}
+	}
+
+	cleared := make(map[string]bool)
+	for _, c := range clearRec.Result().Cookies() {
+		cleared[c.Name] = true
+	}
+	for _, c := range req.Cookies() {
+		if !cleared[c.Name] {
+			t.Errorf("cookie %s present on request was not cleared", c.Name)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+//go:build redis
+
+package refreshstore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vouch/vouch-proxy/pkg/cfg"
+)
+
+// redisStore persists refresh sessions in Redis so that they are shared
+// across vouch-proxy replicas, unlike the default in-memory backend
+type redisStore struct {
+	client *redis.Client
+}
+
+func newRedisStore() (Store, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Cfg.Session.RedisAddr,
+		Password: cfg.Cfg.Session.RedisPassword,
+		DB:       cfg.Cfg.Session.RedisDB,
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, err
+	}
+	return &redisStore{client: client}, nil
+}
+
+func (r *redisStore) Save(sessionID string, s Session) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(s.Expires)
+	return r.client.Set(context.Background(), sessionID, b, ttl).Err()
+}
+
+func (r *redisStore) Get(sessionID string) (Session, bool, error) {
+	var s Session
+	b, err := r.client.Get(context.Background(), sessionID).Bytes()
+	if err == redis.Nil {
+		return s, false, nil
+	}
+	if err != nil {
+		return s, false, err
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return s, false, err
+	}
+	// a session saved with Expires already passed has no ttl in redis
+	if time.Now().After(s.Expires) {
+		return Session{}, false, nil
+	}
+	return s, true, nil
+}
+
+func (r *redisStore) Delete(sessionID string) error {
+	return r.client.Del(context.Background(), sessionID).Err()
+}
@@ -0,0 +1,11 @@
+//go:build !redis
+
+package refreshstore
+
+import "fmt"
+
+// newRedisStore is stubbed out unless vouch-proxy is built with the `redis`
+// build tag, which pulls in the github.com/go-redis/redis client
+func newRedisStore() (Store, error) {
+	return nil, fmt.Errorf("refreshstore: redis backend requested but this binary was not built with the `redis` build tag")
+}
@@ -0,0 +1,96 @@
+// Package refreshstore persists provider refresh tokens server-side, keyed
+// by a random session id that is embedded in the Vouch JWT, so that
+// ValidateRequestHandler can silently re-issue an expiring JWT without
+// sending the user back through the interactive login flow.
+package refreshstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vouch/vouch-proxy/pkg/cfg"
+)
+
+// Session is the data persisted for a single refreshable login
+type Session struct {
+	RefreshToken string
+	Provider     string
+	Username     string
+	// Expires is the maximum total lifetime of the session, independent of
+	// how often the underlying Vouch JWT itself is refreshed
+	Expires time.Time
+}
+
+// Store is implemented by each refresh-token storage backend
+type Store interface {
+	Save(sessionID string, s Session) error
+	Get(sessionID string) (Session, bool, error)
+	Delete(sessionID string) error
+}
+
+var (
+	once  sync.Once
+	store Store
+)
+
+// Get returns the configured Store, constructing it on first use based on
+// cfg.Cfg.Session.RefreshStoreBackend
+func Get() Store {
+	once.Do(func() {
+		store = newStore()
+	})
+	return store
+}
+
+func newStore() Store {
+	switch cfg.Cfg.Session.RefreshStoreBackend {
+	case "redis":
+		rs, err := newRedisStore()
+		if err != nil {
+			cfg.Logging.Logger.Errorf("refreshstore: failed to configure redis backend, falling back to memory: %s", err)
+			return newMemoryStore()
+		}
+		return rs
+	default:
+		return newMemoryStore()
+	}
+}
+
+// memoryStore is the default Store backend: an in-process map. It is not
+// shared across replicas, which is fine for a single vouch instance and is
+// the conservative default when no external backend is configured.
+type memoryStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{sessions: make(map[string]Session)}
+}
+
+func (m *memoryStore) Save(sessionID string, s Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[sessionID] = s
+	return nil
+}
+
+func (m *memoryStore) Get(sessionID string) (Session, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sessions[sessionID]
+	if !ok {
+		return Session{}, false, nil
+	}
+	if time.Now().After(s.Expires) {
+		return Session{}, false, nil
+	}
+	return s, true, nil
+}
+
+func (m *memoryStore) Delete(sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, sessionID)
+	return nil
+}